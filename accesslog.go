@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestIDHeader is the header used to forward/receive a request's
+// correlation ID, so operators can grep a single ID across a load
+// balancer, this service's logs, and any downstream calls.
+const requestIDHeader = "X-Request-Id"
+
+// httpTimeToStatus mirrors the access log's duration/status on every
+// response, the same way Arvados feeds its request logger into a metric:
+// the log line is the source of truth and the histogram is a cheap
+// aggregate view of it.
+var httpTimeToStatus = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "dojo_http_time_to_status_seconds",
+		Help:    "Time to response status by method and status, as logged in the access log",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	},
+	[]string{"method", "status"},
+)
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never errors on the platforms we run on; a
+	// request ID that's all zero on the rare failure is harmless.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// accessLogMiddleware replaces negroni's built-in request logger with a
+// structured JSON log line per response, keyed by a request ID that's
+// echoed back to the client so a slow burn-test request can be correlated
+// with its log entry and with the dojo_http_time_to_status_seconds metric.
+func accessLogMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requestID := req.Header.Get(requestIDHeader)
+			if requestID == "" {
+				requestID = newRequestID()
+			}
+			rw.Header().Set(requestIDHeader, requestID)
+
+			route := "unmatched"
+			if m := mux.CurrentRoute(req); m != nil {
+				if tmpl, err := m.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			sw := &statusCapturingWriter{ResponseWriter: rw, status: http.StatusOK}
+			start := time.Now()
+			next.ServeHTTP(sw, req)
+			duration := time.Since(start)
+
+			logger.Info("http_request",
+				"request_id", requestID,
+				"method", req.Method,
+				"route", route,
+				"status", sw.status,
+				"duration_seconds", duration.Seconds(),
+				"bytes", sw.bytes,
+				"remote_addr", req.RemoteAddr,
+			)
+
+			httpTimeToStatus.
+				WithLabelValues(req.Method, strconv.Itoa(sw.status)).
+				Observe(duration.Seconds())
+		})
+	}
+}
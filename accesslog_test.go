@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(discardWriter{}, nil))
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestAccessLogMiddlewareGeneratesRequestID(t *testing.T) {
+	mw := accessLogMiddleware(discardLogger())
+	handler := mw(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	id := rw.Header().Get(requestIDHeader)
+	if id == "" {
+		t.Fatal("expected a generated X-Request-Id header in the response")
+	}
+}
+
+func TestAccessLogMiddlewareForwardsExistingRequestID(t *testing.T) {
+	mw := accessLogMiddleware(discardLogger())
+	handler := mw(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	req.Header.Set(requestIDHeader, "caller-supplied-id")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	if got := rw.Header().Get(requestIDHeader); got != "caller-supplied-id" {
+		t.Fatalf("X-Request-Id = %q, want the caller-supplied id to be echoed back unchanged", got)
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/sarra-ragguem/dojo-guestbook/internal/delayqueue"
+)
+
+var delayQueue *delayqueue.Manager
+
+// ScheduleHandler handles POST /schedule/{key}?delay=30s. The request body
+// is the value to deliver once the delay elapses; it falls back to the
+// "value" query parameter for quick curl/testing use.
+func ScheduleHandler(rw http.ResponseWriter, req *http.Request) {
+	key := mux.Vars(req)["key"]
+
+	delay, err := time.ParseDuration(req.URL.Query().Get("delay"))
+	if err != nil {
+		http.Error(rw, "invalid or missing delay: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value := req.URL.Query().Get("value")
+	if body, err := io.ReadAll(io.LimitReader(req.Body, 1<<20)); err == nil && len(body) > 0 {
+		value = string(body)
+	}
+
+	if err := delayQueue.Enqueue(key, value, delay); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(rw).Encode(map[string]string{"key": key, "delay": delay.String()})
+}
+
+// ConsumeHandler handles POST /consume/{key}. It is a test-only consumer:
+// it pops one ready message and, unless "fail=true" is set to simulate a
+// failing consumer, acknowledges it immediately. A failed delivery NACKs
+// the message, which reschedules it with backoff until retries run out.
+func ConsumeHandler(rw http.ResponseWriter, req *http.Request) {
+	key := mux.Vars(req)["key"]
+
+	id, payload, err := delayQueue.Consume(key)
+	if errors.Is(err, delayqueue.ErrEmpty) {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	simulateFailure := req.URL.Query().Get("fail") == "true"
+
+	var ackErr error
+	if simulateFailure {
+		ackErr = delayQueue.Nack(key, id)
+	} else {
+		ackErr = delayQueue.Ack(key, id)
+	}
+	if ackErr != nil {
+		http.Error(rw, ackErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"id":      id,
+		"payload": payload,
+		"failed":  simulateFailure,
+	})
+}
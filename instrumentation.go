@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// instrumentation-related metrics. Route label values are the mux route
+// template (e.g. "/lrange/{key}"), not the raw request path, so cardinality
+// stays bounded regardless of how many distinct keys clients use.
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dojo_http_requests_total",
+			Help: "Count of HTTP requests by route and status",
+		},
+		[]string{"route", "method", "status"},
+	)
+
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dojo_http_request_duration_seconds",
+			Help:    "HTTP request latency by route and method",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"route", "method"},
+	)
+
+	httpRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dojo_http_request_size_bytes",
+			Help:    "HTTP request body size by route",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		},
+		[]string{"route"},
+	)
+
+	httpResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dojo_http_response_size_bytes",
+			Help:    "HTTP response body size by route",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		},
+		[]string{"route"},
+	)
+
+	httpInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dojo_http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served",
+		},
+	)
+
+	httpLongestInFlightSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dojo_http_longest_in_flight_seconds",
+			Help: "Age of the longest currently-running in-flight request, in seconds",
+		},
+	)
+)
+
+// inFlightTracker records the start time of every in-flight request so the
+// longest-running one can be reported periodically. It exists because
+// Prometheus gauges can only be set, not queried, so we keep our own side
+// table of start times.
+type inFlightTracker struct {
+	mu     sync.Mutex
+	starts map[*http.Request]time.Time
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{starts: make(map[*http.Request]time.Time)}
+}
+
+func (t *inFlightTracker) start(r *http.Request) {
+	t.mu.Lock()
+	t.starts[r] = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *inFlightTracker) stop(r *http.Request) {
+	t.mu.Lock()
+	delete(t.starts, r)
+	t.mu.Unlock()
+}
+
+// longest returns the age, in seconds, of the oldest in-flight request.
+func (t *inFlightTracker) longest() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var oldest time.Time
+	for _, started := range t.starts {
+		if oldest.IsZero() || started.Before(oldest) {
+			oldest = started
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest).Seconds()
+}
+
+// reportLongest updates httpLongestInFlightSeconds every interval until stop
+// is closed.
+func (t *inFlightTracker) reportLongest(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			httpLongestInFlightSeconds.Set(t.longest())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// statusCapturingWriter wraps http.ResponseWriter to capture the status code
+// and number of bytes written, similar to Arvados' httpserver.Instrument
+// shim. It defaults to 200 if WriteHeader is never called explicitly.
+type statusCapturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	bytes       int
+}
+
+func (w *statusCapturingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusCapturingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+var inFlight = newInFlightTracker()
+
+// instrumentMiddleware is registered via router.Use so it runs after mux has
+// matched the request to a route, meaning mux.CurrentRoute(req) resolves to
+// the route template (e.g. "/lrange/{key}") rather than the raw path. That
+// keeps label cardinality bounded regardless of how many distinct keys
+// clients request.
+func instrumentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		route := "unmatched"
+		if m := mux.CurrentRoute(req); m != nil {
+			if tmpl, err := m.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		httpInFlight.Inc()
+		inFlight.start(req)
+		defer func() {
+			inFlight.stop(req)
+			httpInFlight.Dec()
+		}()
+
+		// ContentLength is -1 when it's unknown (e.g. chunked transfer
+		// encoding), which isn't a real size to feed the histogram;
+		// treat it as 0 rather than polluting the distribution.
+		if req.ContentLength > 0 {
+			httpRequestSize.WithLabelValues(route).Observe(float64(req.ContentLength))
+		} else {
+			httpRequestSize.WithLabelValues(route).Observe(0)
+		}
+
+		sw := &statusCapturingWriter{ResponseWriter: rw, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, req)
+		duration := time.Since(start)
+
+		httpRequestsTotal.WithLabelValues(route, req.Method, strconv.Itoa(sw.status)).Inc()
+		httpRequestDuration.WithLabelValues(route, req.Method).Observe(duration.Seconds())
+		httpResponseSize.WithLabelValues(route).Observe(float64(sw.bytes))
+	})
+}
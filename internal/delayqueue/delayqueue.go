@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package delayqueue implements a Redis-backed delayed/retrying message
+// queue for guestbook entries. It follows the common ZSET-plus-worker
+// pattern: pending messages live in a per-queue sorted set keyed by their
+// execution timestamp, a periodic worker promotes due messages into a
+// ready list via a Lua script (so that multiple app instances racing the
+// same promotion never double-deliver), and a failed consumer NACKs a
+// message back onto the sorted set with exponential backoff until its
+// retries are exhausted, at which point it is moved to a dead list. Which
+// queue keys are active is itself tracked in Redis (not process memory),
+// so any instance's promotion worker can discover and drive a queue that
+// a different, possibly since-restarted, instance originally enqueued
+// into.
+package delayqueue
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redisDoer is the subset of a Redis client that this package needs. It's
+// satisfied by both github.com/sarra-ragguem/dojo-guestbook/internal/redisclient.RedisCli
+// implementations (so the delay queue rides whichever backend REDIS_MODE
+// selected) and by simpleredis' pooled connection directly, which is all
+// the narrower interface this package actually depends on.
+type redisDoer interface {
+	Do(commandName string, args ...interface{}) (interface{}, error)
+}
+
+// DefaultMaxRetries is used for messages enqueued without an explicit retry
+// budget.
+const DefaultMaxRetries = 5
+
+// DefaultBackoffBase is the base delay for the exponential backoff applied
+// on NACK: attempt 1 waits DefaultBackoffBase, attempt 2 waits 2x, etc.
+const DefaultBackoffBase = 2 * time.Second
+
+// ErrEmpty is returned by Consume when the ready list has no messages.
+var ErrEmpty = errors.New("delayqueue: no ready messages")
+
+// ErrNotFound is returned by Consume and Nack when the message's hash no
+// longer exists, e.g. because it has already been acknowledged or
+// dead-lettered. Ack does not check for it.
+var ErrNotFound = errors.New("delayqueue: message not found")
+
+// Manager owns one or more named delay queues backed by the same Redis
+// client and promotes their due messages on a periodic tick.
+type Manager struct {
+	cli        redisDoer
+	logger     *slog.Logger
+	maxRetries int
+	backoff    time.Duration
+
+	enqueued  prometheus.Counter
+	delivered prometheus.Counter
+	retried   prometheus.Counter
+	dead      prometheus.Counter
+}
+
+// NewManager builds a Manager using cli for storage - any backend
+// satisfying redisDoer works, so the delay queue rides whichever
+// REDIS_MODE backend main() selected rather than being pinned to a
+// single-node pool. logger receives one warning per failed background
+// promotion so a stuck worker doesn't fail silently. Metrics are
+// registered by the caller; NewManager only constructs them.
+func NewManager(cli redisDoer, logger *slog.Logger) *Manager {
+	return &Manager{
+		cli:        cli,
+		logger:     logger,
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoffBase,
+
+		enqueued: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dojo_delayqueue_enqueued_total",
+			Help: "Count of messages enqueued into the delay queue",
+		}),
+		delivered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dojo_delayqueue_delivered_total",
+			Help: "Count of messages successfully consumed from the delay queue",
+		}),
+		retried: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dojo_delayqueue_retried_total",
+			Help: "Count of messages NACKed and rescheduled with backoff",
+		}),
+		dead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dojo_delayqueue_dead_total",
+			Help: "Count of messages that exhausted their retries",
+		}),
+	}
+}
+
+// Collectors returns the metrics owned by the Manager, for registration
+// with a prometheus.Registerer.
+func (m *Manager) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.enqueued, m.delivered, m.retried, m.dead}
+}
+
+func pendingKey(key string) string { return "delayqueue:{" + key + "}:pending" }
+func readyKey(key string) string   { return "delayqueue:{" + key + "}:ready" }
+func deadKey(key string) string    { return "delayqueue:{" + key + "}:dead" }
+func seqKey(key string) string     { return "delayqueue:{" + key + "}:seq" }
+func msgKey(key, id string) string { return "delayqueue:{" + key + "}:msg:" + id }
+
+// keysSetKey names the single Redis SET holding every queue key that has
+// ever had a message enqueued or rescheduled. The promotion worker reads
+// it fresh on every tick instead of keeping its own in-process set, so
+// that any instance - including one that just started after a restart or
+// scale-up, and never itself handled the original Enqueue - discovers and
+// promotes pending messages left behind by another instance.
+func keysSetKey() string { return "delayqueue:keys" }
+
+func (m *Manager) conn() redisDoer {
+	return m.cli
+}
+
+// track records key in the shared keysSetKey set so every instance's
+// promotion worker (see Run) discovers it, not just this one. Best-effort:
+// a transient failure here just means this queue isn't promoted until the
+// next successful Enqueue/Nack for the same key adds it again.
+func (m *Manager) track(key string) {
+	if _, err := m.conn().Do("SADD", keysSetKey(), key); err != nil && m.logger != nil {
+		m.logger.Warn("delayqueue: failed to track queue key", "key", key, "err", err)
+	}
+}
+
+// Enqueue schedules value to become available on key's ready list after
+// delay has elapsed.
+func (m *Manager) Enqueue(key, value string, delay time.Duration) error {
+	conn := m.conn()
+
+	id, err := redis.Int64(conn.Do("INCR", seqKey(key)))
+	if err != nil {
+		return err
+	}
+	idStr := strconv.FormatInt(id, 10)
+
+	if _, err := conn.Do("HSET", msgKey(key, idStr), "payload", value, "retries", m.maxRetries, "attempt", 0); err != nil {
+		return err
+	}
+
+	execAt := time.Now().Add(delay).Unix()
+	if _, err := conn.Do("ZADD", pendingKey(key), execAt, idStr); err != nil {
+		return err
+	}
+
+	m.track(key)
+	m.enqueued.Inc()
+	return nil
+}
+
+// Consume pops the next ready message for key, returning its id (needed for
+// Ack/Nack) and payload. It returns ErrEmpty if nothing is ready yet.
+func (m *Manager) Consume(key string) (id, payload string, err error) {
+	conn := m.conn()
+
+	reply, err := conn.Do("RPOP", readyKey(key))
+	if err != nil {
+		return "", "", err
+	}
+	if reply == nil {
+		return "", "", ErrEmpty
+	}
+	id, err = redis.String(reply, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	fields, err := redis.StringMap(conn.Do("HGETALL", msgKey(key, id)))
+	if err != nil {
+		return "", "", err
+	}
+	if len(fields) == 0 {
+		return "", "", ErrNotFound
+	}
+	return id, fields["payload"], nil
+}
+
+// Ack permanently removes a successfully-processed message.
+func (m *Manager) Ack(key, id string) error {
+	if _, err := m.conn().Do("DEL", msgKey(key, id)); err != nil {
+		return err
+	}
+	m.delivered.Inc()
+	return nil
+}
+
+// Nack reschedules a failed message with exponential backoff, or moves it
+// to the dead list once its retries are exhausted.
+func (m *Manager) Nack(key, id string) error {
+	conn := m.conn()
+
+	fields, err := redis.StringMap(conn.Do("HGETALL", msgKey(key, id)))
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return ErrNotFound
+	}
+
+	retries, _ := strconv.Atoi(fields["retries"])
+	attempt, _ := strconv.Atoi(fields["attempt"])
+
+	if retries <= 0 {
+		if _, err := conn.Do("LPUSH", deadKey(key), id); err != nil {
+			return err
+		}
+		if _, err := conn.Do("DEL", msgKey(key, id)); err != nil {
+			return err
+		}
+		m.dead.Inc()
+		return nil
+	}
+
+	attempt++
+	backoff := m.backoff * time.Duration(1<<uint(attempt-1))
+	execAt := time.Now().Add(backoff).Unix()
+
+	if _, err := conn.Do("HSET", msgKey(key, id), "retries", retries-1, "attempt", attempt); err != nil {
+		return err
+	}
+	if _, err := conn.Do("ZADD", pendingKey(key), execAt, id); err != nil {
+		return err
+	}
+
+	m.track(key)
+	m.retried.Inc()
+	return nil
+}
+
+// promoteScript atomically moves every message in pending whose score is
+// due by now into the ready list. Running it as a single EVAL keeps the
+// ZRANGEBYSCORE+LPUSH pair race-free across multiple app instances sharing
+// the same Redis.
+const promoteScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('LPUSH', KEYS[2], id)
+end
+return due
+`
+
+// promote runs promoteScript for a single tracked key.
+func (m *Manager) promote(key string) error {
+	_, err := m.conn().Do("EVAL", promoteScript, 2, pendingKey(key), readyKey(key), time.Now().Unix())
+	return err
+}
+
+// Run starts the periodic promotion worker. It blocks until stop is
+// closed, so callers should run it in its own goroutine. Each tick reads
+// the set of active queue keys from Redis (see keysSetKey) rather than
+// process memory, so a freshly started instance picks up queues it never
+// itself received an Enqueue/Nack for.
+func (m *Manager) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			keys, err := redis.Strings(m.conn().Do("SMEMBERS", keysSetKey()))
+			if err != nil {
+				if m.logger != nil {
+					m.logger.Warn("delayqueue: failed to list queue keys", "err", err)
+				}
+				continue
+			}
+
+			for _, k := range keys {
+				if err := m.promote(k); err != nil && m.logger != nil {
+					m.logger.Warn("delayqueue: promote failed", "key", k, "err", err)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
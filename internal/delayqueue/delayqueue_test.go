@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package delayqueue
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeRedis is a minimal in-memory stand-in for the handful of Redis
+// commands this package issues through redisDoer, so Manager's retry/
+// backoff/promotion logic can be exercised without a real Redis.
+type fakeRedis struct {
+	mu      sync.Mutex
+	hashes  map[string]map[string][]byte
+	zsets   map[string]map[string]float64
+	lists   map[string][]string
+	sets    map[string]map[string]struct{}
+	counter map[string]int64
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		hashes:  make(map[string]map[string][]byte),
+		zsets:   make(map[string]map[string]float64),
+		lists:   make(map[string][]string),
+		sets:    make(map[string]map[string]struct{}),
+		counter: make(map[string]int64),
+	}
+}
+
+func (f *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	str := func(i int) string { return fmt.Sprint(args[i]) }
+
+	switch cmd {
+	case "INCR":
+		key := str(0)
+		f.counter[key]++
+		return f.counter[key], nil
+
+	case "HSET":
+		key := str(0)
+		h, ok := f.hashes[key]
+		if !ok {
+			h = make(map[string][]byte)
+			f.hashes[key] = h
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			h[str(i)] = []byte(str(i + 1))
+		}
+		return "OK", nil
+
+	case "HGETALL":
+		key := str(0)
+		h := f.hashes[key]
+		reply := make([]interface{}, 0, len(h)*2)
+		for field, value := range h {
+			reply = append(reply, []byte(field), value)
+		}
+		return reply, nil
+
+	case "DEL":
+		key := str(0)
+		delete(f.hashes, key)
+		return int64(1), nil
+
+	case "ZADD":
+		key := str(0)
+		z, ok := f.zsets[key]
+		if !ok {
+			z = make(map[string]float64)
+			f.zsets[key] = z
+		}
+		var score float64
+		fmt.Sscanf(str(1), "%g", &score)
+		z[str(2)] = score
+		return int64(1), nil
+
+	case "LPUSH":
+		key := str(0)
+		f.lists[key] = append([]string{str(1)}, f.lists[key]...)
+		return int64(len(f.lists[key])), nil
+
+	case "RPOP":
+		key := str(0)
+		list := f.lists[key]
+		if len(list) == 0 {
+			return nil, nil
+		}
+		last := list[len(list)-1]
+		f.lists[key] = list[:len(list)-1]
+		return []byte(last), nil
+
+	case "SADD":
+		key := str(0)
+		s, ok := f.sets[key]
+		if !ok {
+			s = make(map[string]struct{})
+			f.sets[key] = s
+		}
+		s[str(1)] = struct{}{}
+		return int64(1), nil
+
+	case "SMEMBERS":
+		key := str(0)
+		members := make([]string, 0, len(f.sets[key]))
+		for m := range f.sets[key] {
+			members = append(members, m)
+		}
+		sort.Strings(members)
+		reply := make([]interface{}, len(members))
+		for i, m := range members {
+			reply[i] = []byte(m)
+		}
+		return reply, nil
+
+	case "EVAL":
+		// Emulates promoteScript: move every due member (score <= now)
+		// from the pending ZSET (args[2]) into the ready list (args[3]).
+		pendingKey, readyKey := str(2), str(3)
+		var now float64
+		fmt.Sscanf(str(4), "%g", &now)
+		z := f.zsets[pendingKey]
+		var due []string
+		for id, score := range z {
+			if score <= now {
+				due = append(due, id)
+			}
+		}
+		sort.Strings(due)
+		for _, id := range due {
+			delete(z, id)
+			f.lists[readyKey] = append([]string{id}, f.lists[readyKey]...)
+		}
+		return due, nil
+	}
+
+	return nil, fmt.Errorf("fakeRedis: unsupported command %s", cmd)
+}
+
+func newTestManager() (*Manager, *fakeRedis) {
+	cli := newFakeRedis()
+	m := NewManager(cli, nil)
+	return m, cli
+}
+
+func TestNackBackoffIncreasesExponentiallyThenDeadLetters(t *testing.T) {
+	m, _ := newTestManager()
+	m.maxRetries = 2
+
+	if err := m.Enqueue("k", "payload", 0); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	id := "1"
+	msg := msgKey("k", id)
+
+	// First NACK: one retry consumed, backoff = backoff*2^0.
+	if err := m.Nack("k", id); err != nil {
+		t.Fatalf("Nack #1: %v", err)
+	}
+	retries, attempt := hashInts(t, m, msg)
+	if retries != 1 || attempt != 1 {
+		t.Fatalf("after Nack #1: retries=%d attempt=%d, want 1,1", retries, attempt)
+	}
+	firstScore := zScore(t, m, pendingKey("k"), id)
+	if firstScore <= 0 {
+		t.Fatalf("expected message rescheduled in pending ZSET, got score %v", firstScore)
+	}
+
+	// Second NACK: backoff doubles (backoff*2^1), last retry consumed.
+	if err := m.Nack("k", id); err != nil {
+		t.Fatalf("Nack #2: %v", err)
+	}
+	retries, attempt = hashInts(t, m, msg)
+	if retries != 0 || attempt != 2 {
+		t.Fatalf("after Nack #2: retries=%d attempt=%d, want 0,2", retries, attempt)
+	}
+	// With the default 2s base, Nack #1 schedules at now+2s and Nack #2 at
+	// now+4s, so the second score is at least 2 seconds later.
+	if got := zScore(t, m, pendingKey("k"), id); got-firstScore < 2 {
+		t.Fatalf("second backoff score %v not at least 2s after first %v", got, firstScore)
+	}
+
+	if got := testutil.ToFloat64(m.retried); got != 2 {
+		t.Fatalf("retried counter = %v, want 2", got)
+	}
+
+	// Third NACK: retries exhausted, message moves to the dead list and
+	// its hash is removed.
+	if err := m.Nack("k", id); err != nil {
+		t.Fatalf("Nack #3 (dead-letter): %v", err)
+	}
+	if got := testutil.ToFloat64(m.dead); got != 1 {
+		t.Fatalf("dead counter = %v, want 1", got)
+	}
+	if err := m.Nack("k", id); err != ErrNotFound {
+		t.Fatalf("Nack on dead-lettered message: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConsumeEmptyReturnsErrEmpty(t *testing.T) {
+	m, _ := newTestManager()
+	if _, _, err := m.Consume("nosuchkey"); err != ErrEmpty {
+		t.Fatalf("Consume on empty ready list: err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestPromotePicksUpQueuesDiscoveredFromRedisNotMemory(t *testing.T) {
+	// A second Manager (simulating another instance, or the same
+	// instance after a restart) must discover key "k" from the shared
+	// Redis set rather than its own in-process state.
+	cli := newFakeRedis()
+	writer := NewManager(cli, nil)
+	if err := writer.Enqueue("k", "payload", 0); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	reader := NewManager(cli, nil)
+	keys, err := hgetKeys(reader)
+	if err != nil {
+		t.Fatalf("listing tracked keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "k" {
+		t.Fatalf("tracked keys = %v, want [k]", keys)
+	}
+	if err := reader.promote("k"); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if _, payload, err := reader.Consume("k"); err != nil || payload != "payload" {
+		t.Fatalf("Consume after promote: payload=%q err=%v", payload, err)
+	}
+}
+
+func hgetKeys(m *Manager) ([]string, error) {
+	reply, err := m.conn().Do("SMEMBERS", keysSetKey())
+	if err != nil {
+		return nil, err
+	}
+	items := reply.([]interface{})
+	out := make([]string, len(items))
+	for i, v := range items {
+		out[i] = string(v.([]byte))
+	}
+	return out, nil
+}
+
+func hashInts(t *testing.T, m *Manager, key string) (retries, attempt int) {
+	t.Helper()
+	reply, err := m.conn().Do("HGETALL", key)
+	if err != nil {
+		t.Fatalf("HGETALL %s: %v", key, err)
+	}
+	items := reply.([]interface{})
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		fields[string(items[i].([]byte))] = string(items[i+1].([]byte))
+	}
+	fmt.Sscanf(fields["retries"], "%d", &retries)
+	fmt.Sscanf(fields["attempt"], "%d", &attempt)
+	return
+}
+
+func zScore(t *testing.T, m *Manager, key, member string) float64 {
+	t.Helper()
+	cli, ok := m.cli.(*fakeRedis)
+	if !ok {
+		t.Fatalf("zScore helper requires a *fakeRedis")
+	}
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	return cli.zsets[key][member]
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package redisclient
+
+import (
+	"context"
+	"sync"
+
+	redisv9 "github.com/redis/go-redis/v9"
+)
+
+// GoRedisCli adapts a go-redis/v9 client to RedisCli. The same type backs
+// standalone, Sentinel, and Cluster modes; only construction differs, so
+// handlers never need to know which one they're talking to.
+type GoRedisCli struct {
+	uni     redisv9.UniversalClient
+	cluster *redisv9.ClusterClient // set only by NewGoRedisCluster
+}
+
+// NewGoRedisStandalone connects to a single Redis node at addr (host:port).
+func NewGoRedisStandalone(addr string) *GoRedisCli {
+	return &GoRedisCli{uni: redisv9.NewClient(&redisv9.Options{Addr: addr})}
+}
+
+// NewGoRedisSentinel connects through Sentinel, following masterName.
+func NewGoRedisSentinel(sentinelAddrs []string, masterName string) *GoRedisCli {
+	return &GoRedisCli{uni: redisv9.NewFailoverClient(&redisv9.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: sentinelAddrs,
+	})}
+}
+
+// NewGoRedisCluster connects to a Redis Cluster across addrs.
+func NewGoRedisCluster(addrs []string) *GoRedisCli {
+	cluster := redisv9.NewClusterClient(&redisv9.ClusterOptions{Addrs: addrs})
+	return &GoRedisCli{uni: cluster, cluster: cluster}
+}
+
+func (c *GoRedisCli) Get(key string) (string, error) {
+	v, err := c.uni.Get(context.Background(), key).Result()
+	if err == redisv9.Nil {
+		return "", nil
+	}
+	return v, err
+}
+
+func (c *GoRedisCli) Set(key, value string) error {
+	return c.uni.Set(context.Background(), key, value, 0).Err()
+}
+
+func (c *GoRedisCli) Do(commandName string, args ...interface{}) (interface{}, error) {
+	cmdArgs := append([]interface{}{commandName}, args...)
+	return c.uni.Do(context.Background(), cmdArgs...).Result()
+}
+
+func (c *GoRedisCli) LPush(key, value string) error {
+	return c.uni.LPush(context.Background(), key, value).Err()
+}
+
+func (c *GoRedisCli) LRange(key string, start, stop int) ([]string, error) {
+	return c.uni.LRange(context.Background(), key, int64(start), int64(stop)).Result()
+}
+
+func (c *GoRedisCli) ZAdd(key string, score float64, member string) error {
+	return c.uni.ZAdd(context.Background(), key, redisv9.Z{Score: score, Member: member}).Err()
+}
+
+func (c *GoRedisCli) ZRangeByScore(key, min, max string) ([]string, error) {
+	return c.uni.ZRangeByScore(context.Background(), key, &redisv9.ZRangeBy{Min: min, Max: max}).Result()
+}
+
+func (c *GoRedisCli) Eval(script string, numKeys int, keysAndArgs ...interface{}) (interface{}, error) {
+	keys := make([]string, 0, numKeys)
+	var args []interface{}
+	for i, v := range keysAndArgs {
+		if i < numKeys {
+			keys = append(keys, v.(string))
+		} else {
+			args = append(args, v)
+		}
+	}
+	return c.uni.Eval(context.Background(), script, keys, args...).Result()
+}
+
+func (c *GoRedisCli) Ping() error {
+	return c.uni.Ping(context.Background()).Err()
+}
+
+// PingNodes implements NodeHealth. In Cluster mode it pings every shard
+// individually so one unhealthy node doesn't read as a total outage; in
+// standalone/Sentinel mode it falls back to a single Ping.
+func (c *GoRedisCli) PingNodes() map[string]error {
+	if c.cluster == nil {
+		return map[string]error{"default": c.Ping()}
+	}
+
+	var mu sync.Mutex
+	result := make(map[string]error)
+	ctx := context.Background()
+	_ = c.cluster.ForEachShard(ctx, func(ctx context.Context, shard *redisv9.Client) error {
+		addr := shard.Options().Addr
+		err := shard.Ping(ctx).Err()
+		mu.Lock()
+		result[addr] = err
+		mu.Unlock()
+		return nil
+	})
+	return result
+}
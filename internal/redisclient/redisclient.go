@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package redisclient abstracts over the storage backends the guestbook
+// can run against: the original single-node github.com/xyproto/simpleredis
+// pool, or a go-redis/v9 client that can additionally speak Sentinel and
+// Cluster. Handlers depend only on the RedisCli interface, so switching
+// backend is a matter of which constructor main() calls, selected by the
+// REDIS_MODE environment variable.
+package redisclient
+
+import (
+	"github.com/gomodule/redigo/redis"
+	simpleredis "github.com/xyproto/simpleredis/v2"
+)
+
+// RedisCli is the minimal set of Redis operations the guestbook handlers
+// need, implemented once per supported backend.
+type RedisCli interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Do(commandName string, args ...interface{}) (interface{}, error)
+	LPush(key, value string) error
+	LRange(key string, start, stop int) ([]string, error)
+	ZAdd(key string, score float64, member string) error
+	ZRangeByScore(key, min, max string) ([]string, error)
+	Eval(script string, numKeys int, keysAndArgs ...interface{}) (interface{}, error)
+	Ping() error
+}
+
+// NodeHealth is implemented by the go-redis backend in every mode; in
+// Cluster mode it reports each node separately, otherwise a single
+// "default" entry. HealthHandler type-asserts for it so it can report
+// per-node status instead of a single pass/fail.
+type NodeHealth interface {
+	PingNodes() map[string]error
+}
+
+// SimpleRedisCli adapts the original simpleredis.ConnectionPool to
+// RedisCli.
+type SimpleRedisCli struct {
+	Pool *simpleredis.ConnectionPool
+}
+
+// NewSimpleRedisCli wraps an existing simpleredis pool.
+func NewSimpleRedisCli(pool *simpleredis.ConnectionPool) *SimpleRedisCli {
+	return &SimpleRedisCli{Pool: pool}
+}
+
+func (c *SimpleRedisCli) conn() interface {
+	Do(commandName string, args ...interface{}) (interface{}, error)
+} {
+	return c.Pool.Get(0)
+}
+
+func (c *SimpleRedisCli) Get(key string) (string, error) {
+	return redis.String(c.conn().Do("GET", key))
+}
+
+func (c *SimpleRedisCli) Set(key, value string) error {
+	_, err := c.conn().Do("SET", key, value)
+	return err
+}
+
+func (c *SimpleRedisCli) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.conn().Do(commandName, args...)
+}
+
+func (c *SimpleRedisCli) LPush(key, value string) error {
+	_, err := c.conn().Do("LPUSH", key, value)
+	return err
+}
+
+func (c *SimpleRedisCli) LRange(key string, start, stop int) ([]string, error) {
+	return redis.Strings(c.conn().Do("LRANGE", key, start, stop))
+}
+
+func (c *SimpleRedisCli) ZAdd(key string, score float64, member string) error {
+	_, err := c.conn().Do("ZADD", key, score, member)
+	return err
+}
+
+func (c *SimpleRedisCli) ZRangeByScore(key, min, max string) ([]string, error) {
+	return redis.Strings(c.conn().Do("ZRANGEBYSCORE", key, min, max))
+}
+
+func (c *SimpleRedisCli) Eval(script string, numKeys int, keysAndArgs ...interface{}) (interface{}, error) {
+	args := append([]interface{}{script, numKeys}, keysAndArgs...)
+	return c.conn().Do("EVAL", args...)
+}
+
+func (c *SimpleRedisCli) Ping() error {
+	return c.Pool.Ping()
+}
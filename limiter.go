@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxConcurrentRequests is used when MAX_CONCURRENT_REQUESTS is unset
+// or invalid.
+const DefaultMaxConcurrentRequests = 64
+
+// DefaultRequestDeadline bounds how long any single handler may run before
+// its context is cancelled, so a stuck handler (e.g. /burn under load) can't
+// pin a worker slot forever. REQUEST_DEADLINE overrides it; 0 disables the
+// deadline.
+const DefaultRequestDeadline = 60 * time.Second
+
+var (
+	limiterInUse = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dojo_limiter_in_use",
+		Help: "Number of requests currently holding a concurrency limiter slot",
+	})
+
+	limiterRejectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dojo_limiter_rejected_total",
+		Help: "Count of requests rejected with 503 because the concurrency limit was reached",
+	})
+
+	limiterLongestActiveSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dojo_limiter_longest_active_seconds",
+		Help: "Age of the longest-running request currently holding a limiter slot, including ones whose client has disconnected",
+	})
+
+	limiterAbandonedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dojo_limiter_abandoned_total",
+		Help: "Count of requests whose client disconnected while the handler was still running",
+	})
+)
+
+// activeRequestTracker records the start time of every request currently
+// holding a limiter slot, including ones whose client has disconnected but
+// whose handler is still running (an "abandoned" request) - the handler
+// goroutine stays registered here until it actually returns.
+type activeRequestTracker struct {
+	mu      sync.Mutex
+	nextID  int64
+	started map[int64]time.Time
+}
+
+func newActiveRequestTracker() *activeRequestTracker {
+	return &activeRequestTracker{started: make(map[int64]time.Time)}
+}
+
+func (t *activeRequestTracker) start() int64 {
+	id := atomic.AddInt64(&t.nextID, 1)
+	t.mu.Lock()
+	t.started[id] = time.Now()
+	t.mu.Unlock()
+	return id
+}
+
+func (t *activeRequestTracker) stop(id int64) {
+	t.mu.Lock()
+	delete(t.started, id)
+	t.mu.Unlock()
+}
+
+func (t *activeRequestTracker) longest() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var oldest time.Time
+	for _, started := range t.started {
+		if oldest.IsZero() || started.Before(oldest) {
+			oldest = started
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest).Seconds()
+}
+
+func (t *activeRequestTracker) reportLongest(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			limiterLongestActiveSeconds.Set(t.longest())
+		case <-stop:
+			return
+		}
+	}
+}
+
+var activeRequests = newActiveRequestTracker()
+
+// concurrencyLimiter bounds the number of requests being handled at once.
+// Requests over the limit are rejected immediately with 503 and
+// Retry-After, rather than being queued, so that load tests (and HPA
+// metrics scraping) see backpressure right away instead of pile-up
+// latency.
+type concurrencyLimiter struct {
+	sem      chan struct{}
+	deadline time.Duration
+}
+
+func newConcurrencyLimiter(max int, deadline time.Duration) *concurrencyLimiter {
+	if max < 1 {
+		max = DefaultMaxConcurrentRequests
+	}
+	return &concurrencyLimiter{sem: make(chan struct{}, max), deadline: deadline}
+}
+
+func (l *concurrencyLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			limiterRejectedTotal.Inc()
+			rw.Header().Set("Retry-After", "1")
+			http.Error(rw, "too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() { <-l.sem }()
+
+		limiterInUse.Inc()
+		defer limiterInUse.Dec()
+
+		// Capture the pre-deadline context so the disconnect watcher below
+		// can tell a genuine client disconnect apart from our own deadline
+		// firing - both cancel req.Context(), but only the former should
+		// count as "abandoned".
+		clientCtx := req.Context()
+
+		if l.deadline > 0 {
+			ctx, cancel := context.WithTimeout(req.Context(), l.deadline)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+
+		// Track this request from start to true return - including time
+		// spent running after the client has gone away - without cutting
+		// the handler goroutine off, so limiterLongestActiveSeconds still
+		// reflects an abandoned-but-still-running request.
+		id := activeRequests.start()
+		defer activeRequests.stop(id)
+
+		next.ServeHTTP(rw, req)
+
+		// Checked synchronously after the handler returns, rather than in
+		// a separate goroutine racing the handler's return: a goroutine woken by
+		// clientCtx.Done() has no ordering guarantee against one signaled
+		// by the handler returning, so it could (and did, intermittently)
+		// lose that race and silently miss counting a genuine disconnect.
+		if clientCtx.Err() == context.Canceled {
+			limiterAbandonedTotal.Inc()
+		}
+	})
+}
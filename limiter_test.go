@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConcurrencyLimiterRejectsOverCapacity(t *testing.T) {
+	limiter := newConcurrencyLimiter(1, 0)
+
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	blocking := limiter.middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		close(holding)
+		<-release
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/burn", nil))
+		close(done)
+	}()
+	<-holding
+
+	rejectedBefore := testutil.ToFloat64(limiterRejectedTotal)
+
+	rw := httptest.NewRecorder()
+	blocking.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/burn", nil))
+
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rw.Code)
+	}
+	if rw.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header on a rejected request")
+	}
+	if got := testutil.ToFloat64(limiterRejectedTotal); got != rejectedBefore+1 {
+		t.Fatalf("limiterRejectedTotal = %v, want %v", got, rejectedBefore+1)
+	}
+
+	close(release)
+	<-done
+}
+
+// TestLimiterDeadlineExpiryNotCountedAsAbandoned guards against a handler
+// that legitimately outlives REQUEST_DEADLINE (e.g. /burn under load)
+// being misreported as a client disconnect just because the deadline
+// context also fires Done().
+func TestLimiterDeadlineExpiryNotCountedAsAbandoned(t *testing.T) {
+	limiter := newConcurrencyLimiter(4, 10*time.Millisecond)
+
+	handlerFinished := make(chan struct{})
+	handler := limiter.middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done() // deadline fires well before this returns
+		time.Sleep(20 * time.Millisecond)
+		rw.WriteHeader(http.StatusOK)
+		close(handlerFinished)
+	}))
+
+	abandonedBefore := testutil.ToFloat64(limiterAbandonedTotal)
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/burn", nil))
+	<-handlerFinished
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (handler should finish normally)", rw.Code)
+	}
+	if got := testutil.ToFloat64(limiterAbandonedTotal); got != abandonedBefore {
+		t.Fatalf("limiterAbandonedTotal = %v, want unchanged at %v (deadline expiry isn't a client disconnect)", got, abandonedBefore)
+	}
+}
+
+// TestLimiterGenuineDisconnectCountedAsAbandoned exercises the opposite
+// side: a real client going away mid-request should still be counted.
+func TestLimiterGenuineDisconnectCountedAsAbandoned(t *testing.T) {
+	limiter := newConcurrencyLimiter(4, 0)
+
+	// requestFullyHandled closes once ServeHTTP on the whole middleware
+	// chain returns, i.e. after the abandonment check runs - not just
+	// after the inner handler function returns - so the test can't read
+	// limiterAbandonedTotal before it's updated.
+	requestFullyHandled := make(chan struct{})
+	limited := limiter.middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		limited.ServeHTTP(rw, r)
+		close(requestFullyHandled)
+	}))
+	defer server.Close()
+
+	abandonedBefore := testutil.ToFloat64(limiterAbandonedTotal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-requestFullyHandled
+
+	if got := testutil.ToFloat64(limiterAbandonedTotal); got != abandonedBefore+1 {
+		t.Fatalf("limiterAbandonedTotal = %v, want %v after a genuine client disconnect", got, abandonedBefore+1)
+	}
+}
@@ -6,6 +6,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
@@ -21,10 +23,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
     "github.com/prometheus/client_golang/prometheus/collectors"
     "github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/sarra-ragguem/dojo-guestbook/internal/delayqueue"
+	"github.com/sarra-ragguem/dojo-guestbook/internal/redisclient"
 )
 
 var (
 	masterPool *simpleredis.ConnectionPool
+	redisCli   redisclient.RedisCli
 
 	    redisOps   = prometheus.NewCounterVec(
         prometheus.CounterOpts{
@@ -35,6 +41,32 @@ var (
     )
 )
 
+// newRedisCli builds the RedisCli backend selected by REDIS_MODE
+// ("single", the default; "standalone"; "sentinel"; or "cluster"). "single"
+// wraps the already-connected simpleredis pool; the other three talk to
+// go-redis/v9 so the guestbook can run against HA Redis in production
+// Kubernetes. "standalone" is the same single-node topology as "single"
+// but through the go-redis/v9 client, for operators who want one RedisCli
+// implementation across every REDIS_MODE rather than mixing backends.
+func newRedisCli(pool *simpleredis.ConnectionPool) redisclient.RedisCli {
+	switch os.Getenv("REDIS_MODE") {
+	case "standalone":
+		redisHost := os.Getenv("REDIS_HOST")
+		if redisHost == "" {
+			redisHost = "localhost"
+		}
+		return redisclient.NewGoRedisStandalone(redisHost + ":6379")
+	case "sentinel":
+		addrs := strings.Split(os.Getenv("REDIS_SENTINEL_ADDRS"), ",")
+		return redisclient.NewGoRedisSentinel(addrs, os.Getenv("REDIS_MASTER_NAME"))
+	case "cluster":
+		addrs := strings.Split(os.Getenv("REDIS_CLUSTER_ADDRS"), ",")
+		return redisclient.NewGoRedisCluster(addrs)
+	default:
+		return redisclient.NewSimpleRedisCli(pool)
+	}
+}
+
 // ---------- helpers ----------
 
 func atoiDefault(s string, d int) int {
@@ -55,8 +87,7 @@ func HandleError(result interface{}, err error) (r interface{}) {
 
 func ListRangeHandler(rw http.ResponseWriter, req *http.Request) {
 	key := mux.Vars(req)["key"]
-	list := simpleredis.NewList(masterPool, key)
-	members := HandleError(list.GetAll()).([]string)
+	members := HandleError(redisCli.LRange(key, 0, -1)).([]string)
 	membersJSON := HandleError(json.MarshalIndent(members, "", "  ")).([]byte)
 	rw.Header().Set("Content-Type", "application/json")
 	rw.Write(membersJSON)
@@ -65,15 +96,14 @@ func ListRangeHandler(rw http.ResponseWriter, req *http.Request) {
 func ListPushHandler(rw http.ResponseWriter, req *http.Request) {
 	key := mux.Vars(req)["key"]
 	value := mux.Vars(req)["value"]
-	list := simpleredis.NewList(masterPool, key)
-	HandleError(nil, list.Add(value))
+	HandleError(redisCli.Do("RPUSH", key, value))
 	ListRangeHandler(rw, req)
 }
 
 func InfoHandler(rw http.ResponseWriter, req *http.Request) {
-	info := HandleError(masterPool.Get(0).Do("INFO")).([]byte)
+	info := HandleError(redisCli.Do("INFO"))
 	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	rw.Write(info)
+	rw.Write([]byte(fmt.Sprint(info)))
 }
 
 func EnvHandler(rw http.ResponseWriter, req *http.Request) {
@@ -90,12 +120,34 @@ func EnvHandler(rw http.ResponseWriter, req *http.Request) {
 }
 
 func HealthHandler(rw http.ResponseWriter, req *http.Request) {
-	if err := masterPool.Ping(); err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		rw.Write([]byte(err.Error()))
+	rw.Header().Set("Content-Type", "application/json")
+
+	nh, ok := redisCli.(redisclient.NodeHealth)
+	if !ok {
+		if err := redisCli.Ping(); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
 		return
 	}
-	rw.WriteHeader(http.StatusOK)
+
+	healthy := true
+	status := make(map[string]string)
+	for addr, err := range nh.PingNodes() {
+		if err != nil {
+			healthy = false
+			status[addr] = err.Error()
+			continue
+		}
+		status[addr] = "ok"
+	}
+
+	if !healthy {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(rw).Encode(status)
 }
 
 // /burn?seconds=20&workers=<cpus>&mem_mb=0
@@ -165,12 +217,41 @@ func BurnHandler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
 	    prometheus.MustRegister(
         collectors.NewGoCollector(),
         collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
         redisOps,
+        httpRequestsTotal,
+        httpRequestDuration,
+        httpRequestSize,
+        httpResponseSize,
+        httpInFlight,
+        httpLongestInFlightSeconds,
+        limiterInUse,
+        limiterRejectedTotal,
+        limiterLongestActiveSeconds,
+        limiterAbandonedTotal,
+        httpTimeToStatus,
     )
 
+	stopLongestInFlight := make(chan struct{})
+	defer close(stopLongestInFlight)
+	go inFlight.reportLongest(2*time.Second, stopLongestInFlight)
+
+	stopLongestActive := make(chan struct{})
+	defer close(stopLongestActive)
+	go activeRequests.reportLongest(2*time.Second, stopLongestActive)
+
+	requestDeadline := DefaultRequestDeadline
+	if v := os.Getenv("REQUEST_DEADLINE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			requestDeadline = d
+		}
+	}
+	limiter := newConcurrencyLimiter(atoiDefault(os.Getenv("MAX_CONCURRENT_REQUESTS"), DefaultMaxConcurrentRequests), requestDeadline)
+
 	redisHost := os.Getenv("REDIS_HOST")
 	if redisHost == "" {
 		redisHost = "localhost"
@@ -178,6 +259,15 @@ func main() {
 	masterPool = simpleredis.NewConnectionPoolHost(redisHost + ":6379")
 	defer masterPool.Close()
 
+	redisCli = newRedisCli(masterPool)
+
+	delayQueue = delayqueue.NewManager(redisCli, logger)
+	prometheus.MustRegister(delayQueue.Collectors()...)
+
+	stopDelayQueue := make(chan struct{})
+	defer close(stopDelayQueue)
+	go delayQueue.Run(time.Second, stopDelayQueue)
+
 	r := mux.NewRouter()
 	r.Path("/lrange/{key}").Methods("GET").HandlerFunc(ListRangeHandler)
 	r.Path("/rpush/{key}/{value}").Methods("GET").HandlerFunc(ListPushHandler)
@@ -185,10 +275,15 @@ func main() {
 	r.Path("/env").Methods("GET").HandlerFunc(EnvHandler)
 	r.Path("/healthz").Methods("GET").HandlerFunc(HealthHandler)
 	r.Path("/burn").Methods("GET").HandlerFunc(BurnHandler)
+	r.Path("/schedule/{key}").Methods("POST").HandlerFunc(ScheduleHandler)
+	r.Path("/consume/{key}").Methods("POST").HandlerFunc(ConsumeHandler)
 	r.Path("/metrics").Methods("GET").Handler(promhttp.Handler())
 
+	r.Use(accessLogMiddleware(logger))
+	r.Use(instrumentMiddleware)
+	r.Use(limiter.middleware)
 
-	n := negroni.Classic()
+	n := negroni.New(negroni.NewRecovery())
 	n.UseHandler(r)
 	n.Run(":3000")
 }